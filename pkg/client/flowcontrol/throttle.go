@@ -0,0 +1,159 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package flowcontrol provides client-side rate limiting for outbound
+// requests to an API server.
+package flowcontrol
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a thread-safe interface for throttling outbound requests
+// at a fixed QPS with allowance for short bursts.
+type RateLimiter interface {
+	// TryAccept returns true if a token is available and takes it, or
+	// false if no token is available without blocking.
+	TryAccept() bool
+	// Accept blocks until a token is available.
+	Accept()
+	// Wait blocks until a token is available or ctx is done, whichever
+	// happens first. It returns ctx.Err() if ctx is done before a token
+	// becomes available.
+	Wait(ctx context.Context) error
+	// Stop terminates any background processing used by the limiter.
+	Stop()
+	// QPS returns the maximum average QPS allowed by this limiter.
+	QPS() float32
+}
+
+// NewTokenBucketRateLimiter creates a RateLimiter that allows bursts of up
+// to burst tokens, refilling at qps tokens per second.
+func NewTokenBucketRateLimiter(qps float32, burst int) RateLimiter {
+	if qps <= 0 {
+		return newFakeAlwaysRateLimiter()
+	}
+	return &tokenBucketRateLimiter{
+		qps:    qps,
+		burst:  burst,
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// tokenBucketRateLimiter is a simple, dependency-free token bucket. Tokens
+// are replenished lazily based on elapsed wall-clock time on each call.
+type tokenBucketRateLimiter struct {
+	sync.Mutex
+
+	qps    float32
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func (t *tokenBucketRateLimiter) TryAccept() bool {
+	t.Lock()
+	defer t.Unlock()
+	t.refill()
+	if t.tokens < 1 {
+		return false
+	}
+	t.tokens--
+	return true
+}
+
+func (t *tokenBucketRateLimiter) Accept() {
+	for {
+		t.Lock()
+		t.refill()
+		if t.tokens >= 1 {
+			t.tokens--
+			t.Unlock()
+			return
+		}
+		wait := t.timeUntilNextToken()
+		t.Unlock()
+		time.Sleep(wait)
+	}
+}
+
+func (t *tokenBucketRateLimiter) Wait(ctx context.Context) error {
+	for {
+		t.Lock()
+		t.refill()
+		if t.tokens >= 1 {
+			t.tokens--
+			t.Unlock()
+			return nil
+		}
+		wait := t.timeUntilNextToken()
+		t.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// timeUntilNextToken must be called with the lock held, after a refill that
+// left fewer than 1 token available. It returns how long until a token
+// becomes available. Without the minimum clamp, floating-point rounding can
+// put t.tokens close enough to 1 that (1-t.tokens)/qps rounds down to a
+// non-positive Duration, which would make Accept/Wait spin the lock instead
+// of actually waiting.
+func (t *tokenBucketRateLimiter) timeUntilNextToken() time.Duration {
+	wait := time.Duration(float64(time.Second) * (1 - t.tokens) / float64(t.qps))
+	if wait <= 0 {
+		return time.Millisecond
+	}
+	return wait
+}
+
+// refill must be called with the lock held.
+func (t *tokenBucketRateLimiter) refill() {
+	now := time.Now()
+	elapsed := now.Sub(t.last)
+	t.last = now
+	t.tokens += elapsed.Seconds() * float64(t.qps)
+	if t.tokens > float64(t.burst) {
+		t.tokens = float64(t.burst)
+	}
+}
+
+func (t *tokenBucketRateLimiter) Stop() {}
+
+func (t *tokenBucketRateLimiter) QPS() float32 {
+	return t.qps
+}
+
+type fakeAlwaysRateLimiter struct{}
+
+func newFakeAlwaysRateLimiter() RateLimiter {
+	return &fakeAlwaysRateLimiter{}
+}
+
+func (t *fakeAlwaysRateLimiter) TryAccept() bool                { return true }
+func (t *fakeAlwaysRateLimiter) Accept()                        {}
+func (t *fakeAlwaysRateLimiter) Wait(ctx context.Context) error { return ctx.Err() }
+func (t *fakeAlwaysRateLimiter) Stop()                          {}
+func (t *fakeAlwaysRateLimiter) QPS() float32                   { return 0 }
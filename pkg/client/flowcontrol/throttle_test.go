@@ -0,0 +1,142 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flowcontrol
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketTryAcceptDrainsAndRefills(t *testing.T) {
+	rl := NewTokenBucketRateLimiter(1, 2).(*tokenBucketRateLimiter)
+
+	if !rl.TryAccept() {
+		t.Fatal("expected first token to be available from initial burst")
+	}
+	if !rl.TryAccept() {
+		t.Fatal("expected second token to be available from initial burst")
+	}
+	if rl.TryAccept() {
+		t.Fatal("expected bucket to be empty after burst is consumed")
+	}
+
+	// Simulate 1.5s of elapsed time without sleeping, by rewinding last.
+	rl.Lock()
+	rl.last = rl.last.Add(-1500 * time.Millisecond)
+	rl.Unlock()
+
+	if !rl.TryAccept() {
+		t.Fatal("expected a token to have refilled after 1.5s at 1 qps")
+	}
+}
+
+func TestTokenBucketRefillClampsToBurst(t *testing.T) {
+	rl := NewTokenBucketRateLimiter(10, 3).(*tokenBucketRateLimiter)
+
+	rl.Lock()
+	rl.tokens = 0
+	rl.last = rl.last.Add(-time.Hour)
+	rl.refill()
+	got := rl.tokens
+	rl.Unlock()
+
+	if got != float64(rl.burst) {
+		t.Fatalf("expected refill to clamp to burst=%d, got %v", rl.burst, got)
+	}
+}
+
+func TestTokenBucketRefillAccumulatesFractionalTokens(t *testing.T) {
+	rl := NewTokenBucketRateLimiter(2, 5).(*tokenBucketRateLimiter)
+
+	rl.Lock()
+	rl.tokens = 0
+	rl.last = rl.last.Add(-250 * time.Millisecond)
+	rl.refill()
+	got := rl.tokens
+	rl.Unlock()
+
+	want := 0.5 // 250ms at 2 qps
+	if diff := got - want; diff > 1e-6 || diff < -1e-6 {
+		t.Fatalf("expected ~%v tokens after 250ms at 2 qps, got %v", want, got)
+	}
+}
+
+func TestTokenBucketWaitReturnsImmediatelyWhenTokenAvailable(t *testing.T) {
+	rl := NewTokenBucketRateLimiter(1, 1).(*tokenBucketRateLimiter)
+
+	if err := rl.Wait(context.Background()); err != nil {
+		t.Fatalf("Wait with an available token: %v", err)
+	}
+}
+
+func TestTokenBucketWaitRespectsContextCancellation(t *testing.T) {
+	// A very low QPS with the bucket drained means Wait would otherwise
+	// block for a long time; cancelling ctx should return promptly instead
+	// of spinning or blocking until the token arrives.
+	rl := NewTokenBucketRateLimiter(0.001, 1).(*tokenBucketRateLimiter)
+	rl.Lock()
+	rl.tokens = 0
+	rl.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := rl.Wait(ctx)
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("expected Wait to return an error once ctx is done")
+	}
+	if elapsed > time.Second {
+		t.Fatalf("Wait took %v to notice ctx was done, want well under 1s", elapsed)
+	}
+}
+
+func TestTokenBucketTimeUntilNextTokenNeverNonPositive(t *testing.T) {
+	// Regression test: the raw formula time.Duration(float64(time.Second) *
+	// (1 - t.tokens) / float64(t.qps)) rounds down to <= 0 once t.tokens is
+	// close enough to 1, which would make Accept/Wait spin the lock instead
+	// of actually sleeping. timeUntilNextToken must clamp that away.
+	rl := &tokenBucketRateLimiter{qps: 1, burst: 1, last: time.Now()}
+
+	for _, tokens := range []float64{0, 0.1, 0.5, 0.999999999, 0.9999999999999999} {
+		rl.tokens = tokens
+		if wait := rl.timeUntilNextToken(); wait <= 0 {
+			t.Errorf("tokens=%v produced non-positive wait %v", tokens, wait)
+		}
+	}
+}
+
+func TestTokenBucketQPSAndStop(t *testing.T) {
+	rl := NewTokenBucketRateLimiter(7, 1)
+	if got := rl.QPS(); got != 7 {
+		t.Fatalf("QPS() = %v, want 7", got)
+	}
+	rl.Stop() // must not panic
+}
+
+func TestNewTokenBucketRateLimiterZeroQPSNeverBlocks(t *testing.T) {
+	rl := NewTokenBucketRateLimiter(0, 0)
+	if !rl.TryAccept() {
+		t.Fatal("expected a qps<=0 limiter to always accept")
+	}
+	if err := rl.Wait(context.Background()); err != nil {
+		t.Fatalf("expected a qps<=0 limiter to never block Wait, got %v", err)
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Metrics is the set of hooks a RESTClient calls to report request
+// performance. The package-level default is a no-op, so importing this
+// package never pulls in a metrics backend; callers such as kubelet,
+// controller-manager, or kubectl install a real implementation (e.g.
+// backed by Prometheus) with SetMetrics.
+type Metrics interface {
+	// ObserveRequestLatency records how long verb against url (sanitized
+	// to strip resource names so cardinality stays bounded) took to
+	// complete.
+	ObserveRequestLatency(verb, url string, d time.Duration)
+	// ObserveRequestResult records the HTTP status code a request with verb
+	// completed with, or "<error>" if no response was received.
+	ObserveRequestResult(verb, code string)
+	// ObserveRateLimiterWait records how long a request spent blocked on
+	// the client-side rate limiter before being issued, so client-side
+	// throttling can be told apart from server-side latency.
+	ObserveRateLimiterWait(verb, url string, d time.Duration)
+}
+
+// metrics is the process-wide Metrics implementation used by every
+// RESTClient; defaults to noopMetrics.
+var metrics Metrics = noopMetrics{}
+
+// SetMetrics installs m as the process-wide Metrics implementation. Call it
+// once during startup, before requests are in flight.
+func SetMetrics(m Metrics) {
+	metrics = m
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveRequestLatency(verb, url string, d time.Duration)  {}
+func (noopMetrics) ObserveRequestResult(verb, code string)                   {}
+func (noopMetrics) ObserveRateLimiterWait(verb, url string, d time.Duration) {}
+
+// inflight is the number of requests currently awaiting a response, across
+// every RESTClient in the process.
+var inflight int64
+
+// InflightRequests returns the number of requests currently awaiting a
+// response, across every RESTClient in the process.
+func InflightRequests() int64 {
+	return atomic.LoadInt64(&inflight)
+}
+
+// sanitizedPath returns a URL path with resource names and namespaces
+// stripped, suitable for use as a low-cardinality metrics label. Only the
+// resource kind is kept, e.g. "/pods" rather than "/namespaces/ns/pods/name".
+func (r *Request) sanitizedPath() string {
+	if r.resource == "" {
+		return r.baseURL.Path
+	}
+	return "/" + r.resource
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"mime"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+)
+
+// Media types understood by the built-in NegotiatedSerializer.
+const (
+	ContentTypeJSON     = "application/json"
+	ContentTypeYAML     = "application/yaml"
+	ContentTypeProtobuf = "application/vnd.kubernetes.protobuf"
+)
+
+// NegotiatedSerializer picks an encoder/decoder pair for a request based on
+// the client's preferred Accept media types and the server's response
+// Content-Type, so a RESTClient is not hard-wired to a single wire format.
+type NegotiatedSerializer interface {
+	// SupportedMediaTypes lists the media types this serializer can
+	// produce, most preferred first. The first entry is used to encode
+	// request bodies; the whole list is sent as the Accept header.
+	SupportedMediaTypes() []string
+	// SerializerForMediaType returns the codec registered for mediaType
+	// (parameters such as "; charset=utf-8" are ignored), and false if no
+	// codec is registered for it.
+	SerializerForMediaType(mediaType string) (runtime.Codec, bool)
+}
+
+// simpleNegotiatedSerializer is a NegotiatedSerializer backed by a static,
+// ordered media type -> codec mapping.
+type simpleNegotiatedSerializer struct {
+	order  []string
+	codecs map[string]runtime.Codec
+}
+
+// NewNegotiatedSerializer builds a NegotiatedSerializer that encodes and
+// decodes jsonCodec's format for ContentTypeJSON. Use AddSerializer to
+// register additional formats such as protobuf.
+func NewNegotiatedSerializer(jsonCodec runtime.Codec) *simpleNegotiatedSerializer {
+	return &simpleNegotiatedSerializer{
+		order:  []string{ContentTypeJSON},
+		codecs: map[string]runtime.Codec{ContentTypeJSON: jsonCodec},
+	}
+}
+
+// AddSerializer registers codec for mediaType. The most recently added type
+// becomes the most preferred, i.e. the one used to encode request bodies and
+// listed first in the Accept header.
+func (s *simpleNegotiatedSerializer) AddSerializer(mediaType string, codec runtime.Codec) *simpleNegotiatedSerializer {
+	if _, exists := s.codecs[mediaType]; !exists {
+		s.order = append([]string{mediaType}, s.order...)
+	}
+	s.codecs[mediaType] = codec
+	return s
+}
+
+func (s *simpleNegotiatedSerializer) SupportedMediaTypes() []string {
+	return s.order
+}
+
+func (s *simpleNegotiatedSerializer) SerializerForMediaType(mediaType string) (runtime.Codec, bool) {
+	base := mediaType
+	if parsed, _, err := mime.ParseMediaType(mediaType); err == nil {
+		base = parsed
+	}
+	codec, ok := s.codecs[base]
+	return codec, ok
+}
@@ -0,0 +1,114 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+)
+
+// protobufMagic identifies the envelope written by protobufSerializer: the
+// four bytes "k8s\x00" followed by a protobuf-encoded Unknown message
+// carrying the payload in field 1 (a `bytes` field).
+var protobufMagic = []byte{0x6b, 0x38, 0x73, 0x00}
+
+// protobufRawFieldTag is the wire-format tag for field 1, wire type 2
+// (length-delimited): (1<<3)|2.
+const protobufRawFieldTag = 0x0a
+
+// protobufSerializer implements ContentTypeProtobuf as a genuine protobuf
+// message on the wire: magic bytes followed by a length-delimited field 1
+// containing inner's encoding of the object, equivalent to a minimal
+// `message Unknown { bytes raw = 1; }`.
+//
+// This does NOT yet give the size or speed advantage the protobuf content
+// type is meant to deliver: inner.Encode still produces JSON, so the result
+// is JSON plus a few bytes of protobuf framing, not a compact wire format.
+// That win only arrives once every API type has a generated protobuf
+// marshaler to use as inner; until then, this type exists purely so the
+// Accept/Content-Type plumbing and envelope format are in place and won't
+// need another wire-format bump later. Do not register it as inner=JSON
+// against a server that expects real per-type protobuf encoding — decode
+// will succeed (it's valid protobuf), but the server sees JSON bytes inside
+// the raw field, not the object it asked for.
+type protobufSerializer struct {
+	inner runtime.Codec
+}
+
+// NewProtobufSerializer returns a runtime.Codec for ContentTypeProtobuf that
+// wraps inner's encoding in the envelope described on protobufSerializer.
+func NewProtobufSerializer(inner runtime.Codec) runtime.Codec {
+	return &protobufSerializer{inner: inner}
+}
+
+func (p *protobufSerializer) Encode(obj runtime.Object) ([]byte, error) {
+	raw, err := p.inner.Encode(obj)
+	if err != nil {
+		return nil, err
+	}
+	var length [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(length[:], uint64(len(raw)))
+
+	buf := make([]byte, 0, len(protobufMagic)+1+n+len(raw))
+	buf = append(buf, protobufMagic...)
+	buf = append(buf, protobufRawFieldTag)
+	buf = append(buf, length[:n]...)
+	buf = append(buf, raw...)
+	return buf, nil
+}
+
+func (p *protobufSerializer) DecodeInto(data []byte, obj runtime.Object) error {
+	raw, err := p.unwrap(data)
+	if err != nil {
+		return err
+	}
+	return p.inner.DecodeInto(raw, obj)
+}
+
+func (p *protobufSerializer) unwrap(data []byte) ([]byte, error) {
+	if len(data) < len(protobufMagic)+1 || !hasPrefix(data, protobufMagic) {
+		return nil, fmt.Errorf("data is not valid %s content: missing magic bytes", ContentTypeProtobuf)
+	}
+	rest := data[len(protobufMagic):]
+	if rest[0] != protobufRawFieldTag {
+		return nil, fmt.Errorf("data is not valid %s content: unexpected field tag %#x", ContentTypeProtobuf, rest[0])
+	}
+	rest = rest[1:]
+	length, n := binary.Uvarint(rest)
+	if n <= 0 {
+		return nil, fmt.Errorf("data is not valid %s content: invalid length varint", ContentTypeProtobuf)
+	}
+	body := rest[n:]
+	if uint64(len(body)) != length {
+		return nil, fmt.Errorf("data is not valid %s content: length mismatch", ContentTypeProtobuf)
+	}
+	return body, nil
+}
+
+func hasPrefix(data, prefix []byte) bool {
+	if len(data) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if data[i] != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
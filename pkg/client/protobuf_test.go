@@ -0,0 +1,109 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+)
+
+// fakeObject is a minimal runtime.Object stand-in used by fakeCodec below.
+type fakeObject struct {
+	Value string
+}
+
+// fakeCodec is a trivial runtime.Codec that "encodes" a *fakeObject as its
+// Value field verbatim, so tests can assert on exact bytes.
+type fakeCodec struct{}
+
+func (fakeCodec) Encode(obj runtime.Object) ([]byte, error) {
+	o, ok := obj.(*fakeObject)
+	if !ok {
+		return nil, errors.New("fakeCodec: not a *fakeObject")
+	}
+	return []byte(o.Value), nil
+}
+
+func (fakeCodec) DecodeInto(data []byte, obj runtime.Object) error {
+	o, ok := obj.(*fakeObject)
+	if !ok {
+		return errors.New("fakeCodec: not a *fakeObject")
+	}
+	o.Value = string(data)
+	return nil
+}
+
+func TestProtobufSerializerRoundTrip(t *testing.T) {
+	cases := []string{
+		"",
+		"x",
+		`{"kind":"Pod","items":[1,2,3]}`,
+	}
+	for _, in := range cases {
+		p := NewProtobufSerializer(fakeCodec{})
+		encoded, err := p.Encode(&fakeObject{Value: in})
+		if err != nil {
+			t.Fatalf("Encode(%q): %v", in, err)
+		}
+		if !hasPrefix(encoded, protobufMagic) {
+			t.Fatalf("Encode(%q): missing magic prefix, got %x", in, encoded)
+		}
+
+		var out fakeObject
+		if err := p.DecodeInto(encoded, &out); err != nil {
+			t.Fatalf("DecodeInto(%q): %v", in, err)
+		}
+		if out.Value != in {
+			t.Errorf("round trip mismatch: got %q, want %q", out.Value, in)
+		}
+	}
+}
+
+func TestProtobufSerializerRejectsGarbage(t *testing.T) {
+	p := NewProtobufSerializer(fakeCodec{})
+
+	cases := map[string][]byte{
+		"empty":            {},
+		"wrong magic":      []byte("nope"),
+		"truncated tag":    protobufMagic,
+		"bad tag":          append(append([]byte{}, protobufMagic...), 0xFF),
+		"truncated varint": append(append([]byte{}, protobufMagic...), protobufRawFieldTag, 0x80),
+		"length mismatch":  append(append([]byte{}, protobufMagic...), protobufRawFieldTag, 5, 'a', 'b'),
+	}
+	for name, data := range cases {
+		var out fakeObject
+		if err := p.DecodeInto(data, &out); err == nil {
+			t.Errorf("%s: expected error decoding %x, got nil", name, data)
+		}
+	}
+}
+
+func TestProtobufSerializerLargerThanInner(t *testing.T) {
+	// Document the known limitation called out in protobuf.go: wrapping an
+	// inner JSON codec does not shrink the payload, it adds framing bytes.
+	p := NewProtobufSerializer(fakeCodec{})
+	in := "some payload"
+	encoded, err := p.Encode(&fakeObject{Value: in})
+	if err != nil {
+		t.Fatalf("Encode: %v", err)
+	}
+	if len(encoded) <= len(in) {
+		t.Errorf("expected protobuf envelope to be larger than inner payload, got %d <= %d", len(encoded), len(in))
+	}
+}
@@ -0,0 +1,687 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/flowcontrol"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+
+	"github.com/golang/glog"
+)
+
+// HTTPClient is the subset of *http.Client that Request needs in order to
+// issue a request. Tests can substitute a fake implementation.
+type HTTPClient interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// PollFunc is invoked by Request when a long-running operation needs to be
+// polled for completion. It returns the Request to issue for the next poll,
+// and whether polling should continue. It receives the context of the
+// original call so that polling stops as soon as that context is done.
+type PollFunc func(ctx context.Context, name string) (*Request, bool)
+
+// defaultMaxRetries is how many times a retryable request is re-issued
+// before Do() gives up and returns the last error.
+const defaultMaxRetries = 10
+
+// retryableVerbs may be retried automatically because they are idempotent.
+// POST is not in this set; callers must opt in via Request.RetryPost().
+var retryableVerbs = map[string]bool{
+	"GET":    true,
+	"PUT":    true,
+	"DELETE": true,
+}
+
+// BackoffManager calculates how long to wait before the next retry of a
+// failed request. Implementations must be safe for concurrent use, since a
+// single instance may be shared across every Request issued by a client.
+type BackoffManager interface {
+	Backoff(retries int) time.Duration
+}
+
+// NewExponentialBackoff returns a BackoffManager that doubles its delay from
+// base on every retry, capped at max, with up to 50% jitter so that many
+// clients backing off at once don't retry in lockstep.
+func NewExponentialBackoff(base, max time.Duration) BackoffManager {
+	return &exponentialBackoff{base: base, max: max}
+}
+
+type exponentialBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+func (b *exponentialBackoff) Backoff(retries int) time.Duration {
+	d := b.base
+	for i := 0; i < retries; i++ {
+		d *= 2
+		if d >= b.max {
+			d = b.max
+			break
+		}
+	}
+	// add up to 50% jitter
+	return d + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+// NoBackoff is a BackoffManager that never delays; useful in tests that want
+// retries to run back-to-back.
+var NoBackoff BackoffManager = noBackoff{}
+
+type noBackoff struct{}
+
+func (noBackoff) Backoff(retries int) time.Duration { return 0 }
+
+// Request allows for building up a request to a server in a chained fashion.
+// Any errors are stored until the end of your call, so you only have to
+// check once.
+type Request struct {
+	client HTTPClient
+	verb   string
+
+	baseURL        *url.URL
+	legacyBehavior bool
+	useNamespace   bool
+	codec          runtime.Codec
+
+	resource string
+	name     string
+	subpath  string
+	params   url.Values
+	hasBody  bool
+	body     []byte
+
+	negotiator      NegotiatedSerializer
+	bodyContentType string
+
+	sync    bool
+	timeout time.Duration
+	poller  PollFunc
+	noPoll  bool
+
+	maxRetries int
+	backoff    BackoffManager
+	retryPost  bool
+
+	throttle       flowcontrol.RateLimiter
+	warningHandler WarningHandler
+	ctx            context.Context
+
+	err error
+}
+
+// NewRequest creates a new request helper object for accessing runtime.Objects
+// on a server.
+func NewRequest(client HTTPClient, verb string, baseURL *url.URL, codec runtime.Codec, legacyBehavior, useNamespace bool) *Request {
+	return &Request{
+		client:         client,
+		verb:           verb,
+		baseURL:        baseURL,
+		legacyBehavior: legacyBehavior,
+		useNamespace:   useNamespace,
+		codec:          codec,
+		params:         url.Values{},
+		maxRetries:     defaultMaxRetries,
+		backoff:        NewExponentialBackoff(time.Second, 30*time.Second),
+	}
+}
+
+// Resource sets the resource to access (e.g. "pods").
+func (r *Request) Resource(resource string) *Request {
+	if r.resource != "" {
+		r.err = fmt.Errorf("resource already set to %q, cannot change to %q", r.resource, resource)
+		return r
+	}
+	r.resource = resource
+	return r
+}
+
+// Name sets the name of the resource to access.
+func (r *Request) Name(name string) *Request {
+	if name == "" {
+		r.err = fmt.Errorf("name cannot be empty")
+		return r
+	}
+	r.name = name
+	return r
+}
+
+// Path appends additional segments to the request path, e.g. for subresources.
+func (r *Request) Path(item string) *Request {
+	r.subpath = strings.Trim(r.subpath, "/") + "/" + strings.Trim(item, "/")
+	return r
+}
+
+// Param adds a query parameter to the request.
+func (r *Request) Param(key, value string) *Request {
+	r.params.Add(key, value)
+	return r
+}
+
+// SelectorParam adds a query parameter whose value is a selector, e.g.
+// SelectorParam("labels", "area=staging").
+func (r *Request) SelectorParam(key, value string) *Request {
+	return r.Param(key, value)
+}
+
+// Negotiator installs the NegotiatedSerializer used to pick a wire format:
+// its most preferred media type encodes request bodies and is sent as the
+// Content-Type header, its full list is sent as the Accept header, and the
+// response is decoded according to whichever media type the server actually
+// replies with.
+func (r *Request) Negotiator(n NegotiatedSerializer) *Request {
+	r.negotiator = n
+	return r
+}
+
+// Body sets the body of the request, encoding obj if it is a runtime.Object.
+// The body is captured as a []byte (buffering an io.Reader fully if given
+// one) rather than held open, so that a retried request can replay the same
+// payload instead of resending an already-drained reader. When a
+// NegotiatedSerializer has been installed, obj is encoded in its most
+// preferred media type; otherwise the Request's default codec is used.
+func (r *Request) Body(obj interface{}) *Request {
+	switch t := obj.(type) {
+	case []byte:
+		r.body = t
+	case io.Reader:
+		data, err := ioutil.ReadAll(t)
+		if err != nil {
+			r.err = err
+			return r
+		}
+		r.body = data
+	case runtime.Object:
+		codec := r.codec
+		contentType := ""
+		if r.negotiator != nil {
+			if types := r.negotiator.SupportedMediaTypes(); len(types) > 0 {
+				if c, ok := r.negotiator.SerializerForMediaType(types[0]); ok {
+					codec = c
+					contentType = types[0]
+				}
+			}
+		}
+		data, err := codec.Encode(t)
+		if err != nil {
+			r.err = err
+			return r
+		}
+		r.body = data
+		r.bodyContentType = contentType
+	default:
+		r.err = fmt.Errorf("unknown body type %T", obj)
+		return r
+	}
+	r.hasBody = true
+	return r
+}
+
+// Poller sets the function used to poll for completion of long-running
+// operations.
+func (r *Request) Poller(poller PollFunc) *Request {
+	r.poller = poller
+	return r
+}
+
+// Sync sets whether this request should block until the operation completes.
+func (r *Request) Sync(sync bool) *Request {
+	r.sync = sync
+	return r
+}
+
+// Timeout sets the amount of time the request may take server-side before
+// returning.
+func (r *Request) Timeout(d time.Duration) *Request {
+	r.timeout = d
+	return r
+}
+
+// NoPoll disables polling for this request, regardless of Sync.
+func (r *Request) NoPoll() *Request {
+	r.noPoll = true
+	return r
+}
+
+// MaxRetries overrides the number of times a retryable request is re-issued
+// before Do() gives up.
+func (r *Request) MaxRetries(maxRetries int) *Request {
+	r.maxRetries = maxRetries
+	return r
+}
+
+// BackoffManager overrides the policy used to compute delay between retries
+// when the server does not send a Retry-After header.
+func (r *Request) BackoffManager(manager BackoffManager) *Request {
+	r.backoff = manager
+	return r
+}
+
+// RetryPost opts a POST request in to the automatic 429/503 retry behavior.
+// POST is not retried by default because it is not generally idempotent.
+func (r *Request) RetryPost() *Request {
+	r.retryPost = true
+	return r
+}
+
+// Throttle installs the rate limiter this request waits on before it is
+// issued. Set by RESTClient.Verb from its own Throttle so that every Request
+// it creates shares a single budget.
+func (r *Request) Throttle(limiter flowcontrol.RateLimiter) *Request {
+	r.throttle = limiter
+	return r
+}
+
+// WarningHandler installs the handler notified of every Warning response
+// header this request's responses carry, including error responses and any
+// intermediate poll responses.
+func (r *Request) WarningHandler(handler WarningHandler) *Request {
+	r.warningHandler = handler
+	return r
+}
+
+// Context associates ctx with the request. Cancelling ctx aborts an
+// in-flight transport read, any pending rate-limiter wait, and any poll loop
+// started by Do(). Use DoRaw, Stream, or Watch to supply ctx and execute in
+// one step.
+func (r *Request) Context(ctx context.Context) *Request {
+	r.ctx = ctx
+	return r
+}
+
+func (r *Request) context() context.Context {
+	if r.ctx != nil {
+		return r.ctx
+	}
+	return context.Background()
+}
+
+// URL returns the current working URL of the request.
+func (r *Request) URL() *url.URL {
+	p := r.baseURL.Path
+	if r.resource != "" {
+		p = strings.TrimSuffix(p, "/") + "/" + r.resource
+	}
+	if r.name != "" {
+		p = strings.TrimSuffix(p, "/") + "/" + r.name
+	}
+	if r.subpath != "" {
+		p = strings.TrimSuffix(p, "/") + "/" + strings.TrimPrefix(r.subpath, "/")
+	}
+	finalURL := *r.baseURL
+	finalURL.Path = p
+	query := r.params
+	if query == nil {
+		query = url.Values{}
+	}
+	if r.timeout != 0 {
+		query.Set("timeout", r.timeout.String())
+	}
+	finalURL.RawQuery = query.Encode()
+	return &finalURL
+}
+
+// retryable reports whether this request is eligible for automatic retry on
+// a transient 429/503 response.
+func (r *Request) retryable() bool {
+	return retryableVerbs[r.verb] || (r.verb == "POST" && r.retryPost)
+}
+
+// Do formats and executes the request, following the configured retry and
+// polling policy, and honoring any context installed via Context(). The
+// response is decoded with whichever codec the negotiator selects for the
+// server's Content-Type, falling back to the Request's default codec. See
+// DoRaw for the equivalent call that skips decoding.
+func (r *Request) Do() Result {
+	body, codec, err := r.doRaw(r.context())
+	return Result{body: body, err: err, codec: codec}
+}
+
+// DoRaw executes the request with ctx and returns the raw response body.
+// Cancelling ctx aborts the in-flight read, any pending rate-limiter wait,
+// and any poll loop.
+func (r *Request) DoRaw(ctx context.Context) ([]byte, error) {
+	body, _, err := r.doRaw(ctx)
+	return body, err
+}
+
+func (r *Request) doRaw(ctx context.Context) ([]byte, runtime.Codec, error) {
+	if r.err != nil {
+		return nil, r.codec, r.err
+	}
+
+	client := r.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	path := r.sanitizedPath()
+
+	if r.throttle != nil {
+		now := time.Now()
+		if err := r.throttle.Wait(ctx); err != nil {
+			return nil, r.codec, err
+		}
+		waited := time.Since(now)
+		metrics.ObserveRateLimiterWait(r.verb, path, waited)
+		if waited > time.Second {
+			glog.V(2).Infof("Throttling request took %v, request: %s %s", waited, r.verb, r.URL())
+		}
+	}
+
+	for retries := 0; ; retries++ {
+		var bodyReader io.Reader
+		if r.hasBody {
+			// A fresh reader is built from the captured bytes on every
+			// attempt, so a 429/503 retry replays the same payload instead
+			// of resending an already-drained body.
+			bodyReader = bytes.NewReader(r.body)
+		}
+		req, err := http.NewRequest(r.verb, r.URL().String(), bodyReader)
+		if err != nil {
+			return nil, r.codec, err
+		}
+		req = req.WithContext(ctx)
+		if r.negotiator != nil {
+			req.Header.Set("Accept", strings.Join(r.negotiator.SupportedMediaTypes(), ","))
+		}
+		if r.bodyContentType != "" {
+			req.Header.Set("Content-Type", r.bodyContentType)
+		}
+
+		start := time.Now()
+		atomic.AddInt64(&inflight, 1)
+		resp, err := client.Do(req)
+		if err != nil {
+			atomic.AddInt64(&inflight, -1)
+			metrics.ObserveRequestLatency(r.verb, path, time.Since(start))
+			metrics.ObserveRequestResult(r.verb, "<error>")
+			return nil, r.codec, err
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		atomic.AddInt64(&inflight, -1)
+		metrics.ObserveRequestLatency(r.verb, path, time.Since(start))
+		metrics.ObserveRequestResult(r.verb, strconv.Itoa(resp.StatusCode))
+		if err != nil {
+			return nil, r.codec, err
+		}
+		r.dispatchWarnings(resp)
+		codec := r.responseCodec(resp)
+
+		if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+			if retries >= r.maxRetries || !r.retryable() {
+				return data, codec, r.statusError(resp.StatusCode, data)
+			}
+			wait := retryAfter(resp.Header.Get("Retry-After"))
+			if wait == 0 {
+				wait = r.backoff.Backoff(retries)
+			}
+			glog.V(2).Infof("Got status code %d from %s %s, retrying in %v (retry %d/%d)", resp.StatusCode, r.verb, req.URL, wait, retries+1, r.maxRetries)
+			if err := sleepOrDone(ctx, wait); err != nil {
+				return data, codec, err
+			}
+			continue
+		}
+
+		if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+			return data, codec, r.statusError(resp.StatusCode, data)
+		}
+
+		if !r.sync && !r.noPoll && resp.StatusCode == http.StatusAccepted {
+			return r.poll(ctx, data)
+		}
+
+		return data, codec, nil
+	}
+}
+
+// dispatchWarnings parses every Warning header on resp and hands each one to
+// the installed WarningHandler. Called for every response this Request
+// receives, including error responses and intermediate poll responses, so
+// that deprecation notices surface regardless of how the call ultimately
+// completes.
+func (r *Request) dispatchWarnings(resp *http.Response) {
+	if r.warningHandler == nil {
+		return
+	}
+	for _, header := range resp.Header["Warning"] {
+		for _, w := range parseWarningHeader(header) {
+			r.warningHandler.HandleWarningHeader(w.code, w.agent, w.text)
+		}
+	}
+}
+
+// responseCodec picks the codec to decode resp's body with, based on its
+// Content-Type and the installed negotiator, falling back to the Request's
+// default codec if no negotiator is installed or no match is found.
+func (r *Request) responseCodec(resp *http.Response) runtime.Codec {
+	if r.negotiator == nil {
+		return r.codec
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return r.codec
+	}
+	if codec, ok := r.negotiator.SerializerForMediaType(contentType); ok {
+		return codec
+	}
+	return r.codec
+}
+
+// sleepOrDone waits for d to elapse, returning early with ctx.Err() if ctx
+// is done first.
+func sleepOrDone(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// poll asks the configured PollFunc for the next Request and returns that
+// Request's result. The next Request polls again on a 202 only if it does not
+// have NoPoll set; requests built by RESTClient.Operation (and so by
+// DefaultPoll) do. If the PollFunc reports completion, or ctx is done, the
+// initial response body is returned.
+func (r *Request) poll(ctx context.Context, initial []byte) ([]byte, runtime.Codec, error) {
+	if r.poller == nil {
+		return initial, r.codec, nil
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return initial, r.codec, err
+		}
+		next, ok := r.poller(ctx, r.name)
+		if !ok {
+			return initial, r.codec, nil
+		}
+		return next.doRaw(ctx)
+	}
+}
+
+func (r *Request) statusError(code int, body []byte) error {
+	return fmt.Errorf("request %s %s failed with status %d: %s", r.verb, r.URL(), code, string(body))
+}
+
+// retryAfter parses the Retry-After header, which may be either a number of
+// seconds or an HTTP-date. It returns 0 if the header is absent or invalid.
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(header); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			return 0
+		}
+		return d
+	}
+	return 0
+}
+
+// Result holds the response from a request, to be decoded by the caller
+// into the appropriate runtime.Object.
+type Result struct {
+	body  []byte
+	err   error
+	codec runtime.Codec
+}
+
+// Raw returns the raw bytes of the response and any transport-level error.
+func (r Result) Raw() ([]byte, error) {
+	return r.body, r.err
+}
+
+// Error returns the error, if any, encountered performing the request.
+func (r Result) Error() error {
+	return r.err
+}
+
+// Into decodes the response body into obj using the codec selected for the
+// response's Content-Type, or the Request's default codec if none matched.
+func (r Result) Into(obj runtime.Object) error {
+	if r.err != nil {
+		return r.err
+	}
+	return r.codec.DecodeInto(r.body, obj)
+}
+
+// Stream issues the request and returns the response body unread, so the
+// caller can consume it incrementally (e.g. following logs). The returned
+// ReadCloser must be closed by the caller; closing it or cancelling ctx
+// aborts the underlying connection. Stream does not participate in the
+// 429/503 retry policy, since a partially-read stream cannot be safely
+// replayed.
+func (r *Request) Stream(ctx context.Context) (io.ReadCloser, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if r.throttle != nil {
+		if err := r.throttle.Wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	client := r.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	var bodyReader io.Reader
+	if r.hasBody {
+		bodyReader = bytes.NewReader(r.body)
+	}
+	req, err := http.NewRequest(r.verb, r.URL().String(), bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	if r.negotiator != nil {
+		req.Header.Set("Accept", strings.Join(r.negotiator.SupportedMediaTypes(), ","))
+	}
+	if r.bodyContentType != "" {
+		req.Header.Set("Content-Type", r.bodyContentType)
+	}
+
+	path := r.sanitizedPath()
+	start := time.Now()
+	atomic.AddInt64(&inflight, 1)
+	resp, err := client.Do(req)
+	atomic.AddInt64(&inflight, -1)
+	if err != nil {
+		metrics.ObserveRequestLatency(r.verb, path, time.Since(start))
+		metrics.ObserveRequestResult(r.verb, "<error>")
+		return nil, err
+	}
+	metrics.ObserveRequestLatency(r.verb, path, time.Since(start))
+	metrics.ObserveRequestResult(r.verb, strconv.Itoa(resp.StatusCode))
+	r.dispatchWarnings(resp)
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		return nil, r.statusError(resp.StatusCode, data)
+	}
+	return resp.Body, nil
+}
+
+// WatchEvent is a single change observed on a watch stream: Type is one of
+// "ADDED", "MODIFIED", "DELETED", or "ERROR", and Object is the object's raw
+// JSON as sent by the server. Watch always decodes the stream as JSON; the
+// Request's Negotiator only affects the Accept header it sends.
+type WatchEvent struct {
+	Type   string
+	Object json.RawMessage
+}
+
+// Watch opens a streaming connection to the server and decodes a sequence of
+// WatchEvent values onto the returned channel, which is closed when ctx is
+// done, the connection is lost, or the stream cannot be decoded further.
+func (r *Request) Watch(ctx context.Context) (<-chan WatchEvent, error) {
+	body, err := r.Stream(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan WatchEvent)
+	go func() {
+		defer close(events)
+		defer body.Close()
+
+		decoder := json.NewDecoder(body)
+		for {
+			var event WatchEvent
+			if err := decoder.Decode(&event); err != nil {
+				if err != io.EOF {
+					glog.V(2).Infof("Watch of %s closed with error: %v", r.URL(), err)
+				}
+				return
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return events, nil
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	cases := []struct {
+		name   string
+		header string
+		want   time.Duration
+	}{
+		{"empty", "", 0},
+		{"seconds", "5", 5 * time.Second},
+		{"zero seconds", "0", 0},
+		{"negative seconds", "-5", 0},
+		{"garbage", "not-a-date", 0},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := retryAfter(c.header); got != c.want {
+				t.Errorf("retryAfter(%q) = %v, want %v", c.header, got, c.want)
+			}
+		})
+	}
+}
+
+func TestRetryAfterHTTPDate(t *testing.T) {
+	future := time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat)
+	got := retryAfter(future)
+	if got <= 0 || got > 10*time.Second {
+		t.Errorf("retryAfter(%q) = %v, want roughly 10s", future, got)
+	}
+
+	past := time.Now().Add(-10 * time.Second).UTC().Format(http.TimeFormat)
+	if got := retryAfter(past); got != 0 {
+		t.Errorf("retryAfter(%q) = %v, want 0 for a date in the past", past, got)
+	}
+}
+
+func newTestRequest(verb string, client HTTPClient) *Request {
+	base, _ := url.Parse("http://example.com/")
+	r := NewRequest(client, verb, base, fakeCodec{}, false, false)
+	r = r.BackoffManager(NoBackoff)
+	return r
+}
+
+// countingServer answers the first failCount requests with status, and every
+// later one with a 200 OK, and records the body of every request it receives.
+func countingServer(t *testing.T, status int, failCount int) (*httptest.Server, *[][]byte) {
+	var bodies [][]byte
+	calls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		data, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatalf("reading request body: %v", err)
+		}
+		bodies = append(bodies, data)
+		calls++
+		if calls <= failCount {
+			w.WriteHeader(status)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("ok"))
+	}))
+	return srv, &bodies
+}
+
+func TestDoRawRetriesOnTooManyRequests(t *testing.T) {
+	srv, bodies := countingServer(t, http.StatusTooManyRequests, 2)
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL)
+	r := NewRequest(http.DefaultClient, "PUT", base, fakeCodec{}, false, false).
+		BackoffManager(NoBackoff).
+		Body([]byte("payload"))
+
+	data, _, err := r.doRaw(context.Background())
+	if err != nil {
+		t.Fatalf("doRaw: %v", err)
+	}
+	if string(data) != "ok" {
+		t.Fatalf("doRaw returned %q, want %q", data, "ok")
+	}
+	if len(*bodies) != 3 {
+		t.Fatalf("expected 3 requests (2 failures + success), got %d", len(*bodies))
+	}
+	for i, b := range *bodies {
+		if string(b) != "payload" {
+			t.Errorf("request %d body = %q, want replayed %q", i, b, "payload")
+		}
+	}
+}
+
+func TestDoRawGivesUpAfterMaxRetries(t *testing.T) {
+	srv, bodies := countingServer(t, http.StatusServiceUnavailable, 100)
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL)
+	r := NewRequest(http.DefaultClient, "GET", base, fakeCodec{}, false, false).
+		BackoffManager(NoBackoff).
+		MaxRetries(2)
+
+	_, _, err := r.doRaw(context.Background())
+	if err == nil {
+		t.Fatal("expected an error after exhausting retries")
+	}
+	if len(*bodies) != 3 { // initial attempt + 2 retries
+		t.Fatalf("expected 3 requests (1 initial + 2 retries), got %d", len(*bodies))
+	}
+}
+
+func TestDoRawDoesNotRetryPostByDefault(t *testing.T) {
+	srv, bodies := countingServer(t, http.StatusServiceUnavailable, 100)
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL)
+	r := NewRequest(http.DefaultClient, "POST", base, fakeCodec{}, false, false).
+		BackoffManager(NoBackoff)
+
+	_, _, err := r.doRaw(context.Background())
+	if err == nil {
+		t.Fatal("expected an error since POST is not retried by default")
+	}
+	if len(*bodies) != 1 {
+		t.Fatalf("expected exactly 1 request for a non-retried POST, got %d", len(*bodies))
+	}
+}
+
+func TestDoRawRetriesPostWithRetryPost(t *testing.T) {
+	srv, bodies := countingServer(t, http.StatusServiceUnavailable, 1)
+	defer srv.Close()
+
+	base, _ := url.Parse(srv.URL)
+	r := NewRequest(http.DefaultClient, "POST", base, fakeCodec{}, false, false).
+		BackoffManager(NoBackoff).
+		RetryPost()
+
+	data, _, err := r.doRaw(context.Background())
+	if err != nil {
+		t.Fatalf("doRaw: %v", err)
+	}
+	if string(data) != "ok" {
+		t.Fatalf("doRaw returned %q, want %q", data, "ok")
+	}
+	if len(*bodies) != 2 {
+		t.Fatalf("expected 2 requests (1 failure + success) once RetryPost is set, got %d", len(*bodies))
+	}
+}
+
+func TestExponentialBackoffCapsAndJitters(t *testing.T) {
+	b := NewExponentialBackoff(10*time.Millisecond, 100*time.Millisecond)
+	for retries := 0; retries < 10; retries++ {
+		d := b.Backoff(retries)
+		if d < 0 {
+			t.Fatalf("Backoff(%d) = %v, want non-negative", retries, d)
+		}
+		// Capped base is 100ms, plus up to 50% jitter.
+		if d > 150*time.Millisecond {
+			t.Fatalf("Backoff(%d) = %v, want <= 150ms (cap + 50%% jitter)", retries, d)
+		}
+	}
+}
+
+func TestNoBackoffNeverDelays(t *testing.T) {
+	if d := NoBackoff.Backoff(5); d != 0 {
+		t.Fatalf("NoBackoff.Backoff(5) = %v, want 0", d)
+	}
+}
+
+// erroringReader returns an error when read, to exercise Body()'s error path
+// for non-[]byte io.Readers.
+type erroringReader struct{}
+
+func (erroringReader) Read(p []byte) (int, error) { return 0, errors.New("boom") }
+
+func TestBodyPropagatesReadError(t *testing.T) {
+	r := newTestRequest("POST", http.DefaultClient).Body(erroringReader{})
+	if r.err == nil {
+		t.Fatal("expected Body to record the read error")
+	}
+}
@@ -17,15 +17,25 @@ limitations under the License.
 package client
 
 import (
+	"context"
 	"net/url"
 	"strings"
 	"time"
 
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/client/flowcontrol"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
 
 	"github.com/golang/glog"
 )
 
+// Default rate limit applied to a RESTClient that does not specify its own
+// Throttle. Matches the historical defaults used by the Kubernetes API
+// clients: 5 queries per second with bursts of up to 10.
+const (
+	defaultQPS   = 5.0
+	defaultBurst = 10
+)
+
 // RESTClient imposes common Kubernetes API conventions on a set of resource paths.
 // The baseURL is expected to point to an HTTP or HTTPS path that is the parent
 // of one or more resources.  The server should return a decodable API resource
@@ -44,9 +54,40 @@ type RESTClient struct {
 	LegacyBehavior bool
 
 	// Codec is the encoding and decoding scheme that applies to a particular set of
-	// REST resources.
+	// REST resources. Used directly whenever Negotiator is nil, and as the
+	// fallback format if Negotiator can't match the server's Content-Type.
 	Codec runtime.Codec
 
+	// Negotiator, if set, lets RESTClient speak more than one wire format
+	// (e.g. protobuf in addition to JSON): it builds the Accept header from
+	// its supported media types, encodes request bodies in its most
+	// preferred type, and decodes responses according to the server's
+	// actual Content-Type.
+	Negotiator NegotiatedSerializer
+
+	// Throttle governs the rate at which requests are allowed to hit the
+	// server. It is shared across every Request created by this client (and
+	// any Client built on top of it), so all resource helpers are limited by
+	// a single bucket even when called from multiple goroutines. Defaults to
+	// a token bucket allowing defaultQPS queries per second with bursts of
+	// defaultBurst.
+	Throttle flowcontrol.RateLimiter
+
+	// MaxRetries is the number of times a request that fails with a
+	// retryable status (429, 503) is re-issued before giving up. Defaults to
+	// defaultMaxRetries.
+	MaxRetries int
+
+	// Backoff computes how long to wait between retries when the server does
+	// not send a Retry-After header. Defaults to a truncated exponential
+	// backoff starting at 1s and capped at 30s, plus up to 50% jitter.
+	Backoff BackoffManager
+
+	// WarningHandler is notified of every Warning response header the
+	// server sends back (e.g. deprecated API or field usage). Defaults to
+	// a handler that logs each distinct warning once via glog.Warning.
+	WarningHandler WarningHandler
+
 	// Set specific behavior of the client.  If not set http.DefaultClient will be
 	// used.
 	Client HTTPClient
@@ -64,7 +105,10 @@ type RESTClient struct {
 // such as Get, Put, Post, and Delete on specified paths.  Codec controls encoding and
 // decoding of responses from the server. If this client should use the older, legacy
 // API conventions from Kubernetes API v1beta1 and v1beta2, set legacyBehavior true.
-func NewRESTClient(baseURL *url.URL, apiVersion string, c runtime.Codec, legacyBehavior bool) *RESTClient {
+// qps and burst configure the client-side Throttle; pass 0 for either to fall back to
+// defaultQPS/defaultBurst. Callers that need a different RateLimiter entirely (or none)
+// can still overwrite the returned client's Throttle field directly.
+func NewRESTClient(baseURL *url.URL, apiVersion string, c runtime.Codec, legacyBehavior bool, qps float32, burst int) *RESTClient {
 	base := *baseURL
 	if !strings.HasSuffix(base.Path, "/") {
 		base.Path += "/"
@@ -72,6 +116,13 @@ func NewRESTClient(baseURL *url.URL, apiVersion string, c runtime.Codec, legacyB
 	base.RawQuery = ""
 	base.Fragment = ""
 
+	if qps <= 0 {
+		qps = defaultQPS
+	}
+	if burst <= 0 {
+		burst = defaultBurst
+	}
+
 	return &RESTClient{
 		baseURL:    &base,
 		apiVersion: apiVersion,
@@ -80,6 +131,13 @@ func NewRESTClient(baseURL *url.URL, apiVersion string, c runtime.Codec, legacyB
 
 		LegacyBehavior: legacyBehavior,
 
+		Throttle: flowcontrol.NewTokenBucketRateLimiter(qps, burst),
+
+		MaxRetries: defaultMaxRetries,
+		Backoff:    NewExponentialBackoff(time.Second, 30*time.Second),
+
+		WarningHandler: NewDefaultWarningHandler(),
+
 		// Make asynchronous requests by default
 		Sync: false,
 
@@ -110,7 +168,23 @@ func (c *RESTClient) Verb(verb string) *Request {
 	if poller == nil {
 		poller = c.DefaultPoll
 	}
-	return NewRequest(c.Client, verb, c.baseURL, c.Codec, c.LegacyBehavior, c.LegacyBehavior).Poller(poller).Sync(c.Sync).Timeout(c.Timeout)
+	req := NewRequest(c.Client, verb, c.baseURL, c.Codec, c.LegacyBehavior, c.LegacyBehavior).Poller(poller).Sync(c.Sync).Timeout(c.Timeout)
+	if c.MaxRetries != 0 {
+		req = req.MaxRetries(c.MaxRetries)
+	}
+	if c.Backoff != nil {
+		req = req.BackoffManager(c.Backoff)
+	}
+	if c.Throttle != nil {
+		req = req.Throttle(c.Throttle)
+	}
+	if c.Negotiator != nil {
+		req = req.Negotiator(c.Negotiator)
+	}
+	if c.WarningHandler != nil {
+		req = req.WarningHandler(c.WarningHandler)
+	}
+	return req
 }
 
 // Post begins a POST request. Short for c.Verb("POST").
@@ -139,12 +213,19 @@ func (c *RESTClient) Operation(name string) *Request {
 }
 
 // DefaultPoll performs a polling action based on the PollPeriod set on the Client.
-func (c *RESTClient) DefaultPoll(name string) (*Request, bool) {
+// Polling stops early, returning false, if ctx is done before PollPeriod elapses.
+func (c *RESTClient) DefaultPoll(ctx context.Context, name string) (*Request, bool) {
 	if c.PollPeriod == 0 {
 		return nil, false
 	}
 	glog.Infof("Waiting for completion of operation %s", name)
-	time.Sleep(c.PollPeriod)
+	timer := time.NewTimer(c.PollPeriod)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, false
+	}
 	// Make a poll request
 	return c.Operation(name).Poller(c.DefaultPoll), true
 }
@@ -0,0 +1,143 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/golang/glog"
+)
+
+// WarningHandler is notified of every RFC 7234 Warning response header a
+// server sends, which the Kubernetes API server uses to flag things like
+// deprecated APIs or deprecated field usage.
+type WarningHandler interface {
+	// HandleWarningHeader is called once per Warning header value, with
+	// the warn-code (299 for API server warnings), warn-agent, and
+	// warn-text fields as parsed from the header.
+	HandleWarningHeader(code int, agent, text string)
+}
+
+// NewDefaultWarningHandler returns a WarningHandler that logs each distinct
+// warning text once per process via glog.Warning.
+func NewDefaultWarningHandler() WarningHandler {
+	return processWarningHandler
+}
+
+// processWarningHandler is the single handler NewDefaultWarningHandler hands
+// out, so every RESTClient in the process shares one set of seen warnings.
+var processWarningHandler = &defaultWarningHandler{seen: map[string]bool{}}
+
+type defaultWarningHandler struct {
+	mu   sync.Mutex
+	seen map[string]bool
+}
+
+func (h *defaultWarningHandler) HandleWarningHeader(code int, agent, text string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.seen[text] {
+		return
+	}
+	h.seen[text] = true
+	glog.Warning(text)
+}
+
+// NullWarningHandler discards every warning. Useful in tests that don't want
+// warnings to pollute log output.
+var NullWarningHandler WarningHandler = nullWarningHandler{}
+
+type nullWarningHandler struct{}
+
+func (nullWarningHandler) HandleWarningHeader(code int, agent, text string) {}
+
+// WarningWriterOptions configures NewWarningWriter.
+type WarningWriterOptions struct {
+	// Color, if true, writes "Warning:" in yellow.
+	Color bool
+	// Deduplicate suppresses repeats of a warning with identical text.
+	Deduplicate bool
+}
+
+// NewWarningWriter returns a WarningHandler that prints each warning to w,
+// one per line, e.g. so a kubectl-like CLI can surface warnings on stderr.
+func NewWarningWriter(w io.Writer, opts WarningWriterOptions) WarningHandler {
+	return &warningWriter{w: w, opts: opts, seen: map[string]bool{}}
+}
+
+type warningWriter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	opts WarningWriterOptions
+	seen map[string]bool
+}
+
+func (w *warningWriter) HandleWarningHeader(code int, agent, text string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.opts.Deduplicate {
+		if w.seen[text] {
+			return
+		}
+		w.seen[text] = true
+	}
+	if w.opts.Color {
+		fmt.Fprintf(w.w, "\x1b[33mWarning:\x1b[0m %s\n", text)
+		return
+	}
+	fmt.Fprintf(w.w, "Warning: %s\n", text)
+}
+
+// warningHeaderRE matches one RFC 7234 warn-value within a Warning header,
+// e.g. `299 - "this field is deprecated"`, optionally followed by a quoted
+// date that this client ignores. A single header line may carry several
+// comma-separated warn-values, so callers use FindAllStringSubmatch.
+var warningHeaderRE = regexp.MustCompile(`(\d{3})\s+(\S+)\s+"((?:[^"\\]|\\.)*)"`)
+
+// warning is a single parsed Warning header warn-value.
+type warning struct {
+	code  int
+	agent string
+	text  string
+}
+
+// parseWarningHeader parses every warn-value out of a single Warning header
+// line, skipping any that don't match the expected format.
+func parseWarningHeader(value string) []warning {
+	matches := warningHeaderRE.FindAllStringSubmatch(value, -1)
+	warnings := make([]warning, 0, len(matches))
+	for _, m := range matches {
+		code, err := strconv.Atoi(m[1])
+		if err != nil {
+			continue
+		}
+		warnings = append(warnings, warning{code: code, agent: m[2], text: unescapeWarningText(m[3])})
+	}
+	return warnings
+}
+
+func unescapeWarningText(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	return strings.NewReplacer(`\"`, `"`, `\\`, `\`).Replace(s)
+}
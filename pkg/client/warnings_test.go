@@ -0,0 +1,134 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestParseWarningHeaderSingleValue(t *testing.T) {
+	got := parseWarningHeader(`299 - "this field is deprecated"`)
+	want := []warning{{code: 299, agent: "-", text: "this field is deprecated"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseWarningHeaderMultipleCommaSeparatedValues(t *testing.T) {
+	header := `299 - "first warning", 299 agent-two "second warning"`
+	got := parseWarningHeader(header)
+	want := []warning{
+		{code: 299, agent: "-", text: "first warning"},
+		{code: 299, agent: "agent-two", text: "second warning"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestParseWarningHeaderEscapedQuotesAndBackslashes(t *testing.T) {
+	header := `299 - "quote: \"nested\", slash: \\backslash\\"`
+	got := parseWarningHeader(header)
+	if len(got) != 1 {
+		t.Fatalf("expected 1 warn-value, got %d: %+v", len(got), got)
+	}
+	want := `quote: "nested", slash: \backslash\`
+	if got[0].text != want {
+		t.Fatalf("text = %q, want %q", got[0].text, want)
+	}
+}
+
+func TestParseWarningHeaderSkipsMalformedValues(t *testing.T) {
+	cases := []string{
+		"",
+		"not a warning",
+		`299 agent-with-no-quotes`,
+		`299 - unterminated quote`,
+	}
+	for _, header := range cases {
+		if got := parseWarningHeader(header); len(got) != 0 {
+			t.Errorf("parseWarningHeader(%q) = %+v, want empty", header, got)
+		}
+	}
+}
+
+func TestUnescapeWarningText(t *testing.T) {
+	cases := []struct {
+		in, want string
+	}{
+		{"no escapes here", "no escapes here"},
+		{`escaped \"quote\"`, `escaped "quote"`},
+		{`escaped \\backslash`, `escaped \backslash`},
+		{`mixed \\ and \"`, `mixed \ and "`},
+	}
+	for _, c := range cases {
+		if got := unescapeWarningText(c.in); got != c.want {
+			t.Errorf("unescapeWarningText(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestDefaultWarningHandlerDeduplicates(t *testing.T) {
+	h := NewDefaultWarningHandler()
+	// Just assert it doesn't panic on repeated identical text; the log
+	// destination (glog) isn't something this test can observe directly.
+	h.HandleWarningHeader(299, "-", "duplicate me")
+	h.HandleWarningHeader(299, "-", "duplicate me")
+	h.HandleWarningHeader(299, "-", "different text")
+}
+
+func TestNullWarningHandlerDiscardsEverything(t *testing.T) {
+	// Must not panic; there's nothing else to assert.
+	NullWarningHandler.HandleWarningHeader(299, "-", "ignored")
+}
+
+func TestWarningWriterWritesEachWarning(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWarningWriter(&buf, WarningWriterOptions{})
+	w.HandleWarningHeader(299, "-", "first")
+	w.HandleWarningHeader(299, "-", "second")
+
+	want := "Warning: first\nWarning: second\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWarningWriterDeduplicates(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWarningWriter(&buf, WarningWriterOptions{Deduplicate: true})
+	w.HandleWarningHeader(299, "-", "repeat")
+	w.HandleWarningHeader(299, "-", "repeat")
+
+	want := "Warning: repeat\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWarningWriterColor(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWarningWriter(&buf, WarningWriterOptions{Color: true})
+	w.HandleWarningHeader(299, "-", "colored")
+
+	want := "\x1b[33mWarning:\x1b[0m colored\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}